@@ -0,0 +1,706 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datawire/teleproxy/pkg/consulwatch"
+	"github.com/datawire/teleproxy/pkg/health"
+	"github.com/datawire/teleproxy/pkg/k8s"
+	"github.com/datawire/teleproxy/pkg/resolver"
+	"github.com/datawire/teleproxy/pkg/supervisor"
+	"github.com/datawire/teleproxy/pkg/watt"
+)
+
+// resolverAnnotations maps the getambassador.io ConfigMap annotation
+// for each resolver.Kind watt has built-in support for.
+var resolverAnnotations = map[string]resolver.Kind{
+	"getambassador.io/consul-resolver":        resolver.Consul,
+	"getambassador.io/dns-srv-resolver":       resolver.DNSSRV,
+	"getambassador.io/endpointslice-resolver": resolver.EndpointSlice,
+}
+
+// defaultCoalesceInterval is how long the aggregator waits for more
+// changes to arrive before emitting a snapshot, and
+// defaultMaxPendingSnapshots is how many unconsumed snapshots it will
+// queue for a slow reader before dropping the oldest ones.
+const (
+	defaultCoalesceInterval    = 200 * time.Millisecond
+	defaultMaxPendingSnapshots = 10
+)
+
+// k8sEvent is the complete set of resources of a single kind
+// currently known to the Kubernetes watch manager.
+type k8sEvent struct {
+	kind      string
+	resources []k8s.Resource
+}
+
+// WatchSpec tells the watch manager which Resolver backend to start
+// or stop watching for a ConfigMap.
+type WatchSpec struct {
+	ResolverKind resolver.Kind
+	ConfigMap    k8s.Resource
+}
+
+// ResolverUpdate is how a watch manager reports a Resolver's latest
+// endpoints for a service back to the aggregator. Consul keeps its
+// own dedicated ConsulEndpoints channel; this one is for every other
+// resolver.Kind.
+type ResolverUpdate struct {
+	Kind      resolver.Kind
+	Endpoints resolver.Endpoints
+}
+
+// backendKey identifies one service as watched by one resolver.Kind.
+type backendKey struct {
+	kind    resolver.Kind
+	service string
+}
+
+// EventKind identifies the lifecycle transitions the aggregator
+// reports on its events channel.
+type EventKind string
+
+const (
+	EventBootstrapped                EventKind = "Bootstrapped"
+	EventResolverAdded               EventKind = "ResolverAdded"
+	EventResolverRemoved             EventKind = "ResolverRemoved"
+	EventConsulServiceFirstEndpoints EventKind = "ConsulServiceFirstEndpoints"
+	EventKubernetesKindResynced      EventKind = "KubernetesKindResynced"
+	EventSnapshotDropped             EventKind = "SnapshotDropped"
+	EventShuttingDown                EventKind = "ShuttingDown"
+)
+
+// Event is a single lifecycle transition reported by the aggregator.
+// Which fields are set depends on Kind: see the comments on each one.
+type Event struct {
+	Kind EventKind
+
+	// ResolverKind and Service identify the backend for
+	// ResolverAdded, ResolverRemoved, and
+	// ConsulServiceFirstEndpoints.
+	ResolverKind resolver.Kind `json:",omitempty"`
+	Service      string        `json:",omitempty"`
+
+	// K8sKind identifies the kind for KubernetesKindResynced.
+	K8sKind string `json:",omitempty"`
+
+	// Count is how many snapshots were dropped, for SnapshotDropped.
+	Count int `json:",omitempty"`
+
+	// Reason and InFlightWatches describe a ShuttingDown event.
+	Reason          string `json:",omitempty"`
+	InFlightWatches int    `json:",omitempty"`
+}
+
+// ResourceRef identifies a Kubernetes resource without carrying its
+// full body, which is all a consumer needs in order to know that a
+// previously-seen resource is gone.
+type ResourceRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// SnapshotDelta describes what changed in a Snapshot relative to the
+// snapshot tagged BaseVersion: Kubernetes resources that were added
+// or removed (by kind+namespace+name), Consul endpoints that were
+// added, changed, or removed (by service), and non-Consul resolver
+// endpoints that were added, changed, or removed (by resolver.Kind and
+// service).
+//
+// A nil entry in ConsulEndpointChanges or ResolverEndpointChanges
+// means the service's endpoints were removed.
+type SnapshotDelta struct {
+	K8sAdds                 map[string][]k8s.Resource                 `json:",omitempty"`
+	K8sDeletes              map[string][]ResourceRef                  `json:",omitempty"`
+	ConsulEndpointChanges   map[string]*consulwatch.Endpoints         `json:",omitempty"`
+	ResolverEndpointChanges map[string]map[string]*resolver.Endpoints `json:",omitempty"`
+}
+
+// SnapshotUpdate is what the aggregator publishes on its deltas
+// channel: either a full snapshot (BaseVersion 0) or an incremental
+// SnapshotDelta against BaseVersion.
+type SnapshotUpdate struct {
+	Version     int
+	BaseVersion int
+	Full        *watt.Snapshot `json:",omitempty"`
+	Delta       *SnapshotDelta `json:",omitempty"`
+}
+
+// AggregatorOption configures optional behavior on an aggregator
+// constructed by NewAggregator.
+type AggregatorOption func(*aggregator)
+
+// WithDeltas makes the aggregator additionally publish a
+// SnapshotUpdate to deltas every time it publishes a full snapshot
+// that differs from the previous one (a snapshot with no change
+// produces no SnapshotUpdate), letting a consumer that has the previous version avoid re-parsing
+// the whole thing.
+func WithDeltas(deltas chan<- SnapshotUpdate) AggregatorOption {
+	return func(a *aggregator) {
+		a.deltas = deltas
+	}
+}
+
+// WithCoalesceInterval overrides how long the aggregator waits for
+// more changes to arrive before emitting a snapshot. The default is
+// defaultCoalesceInterval.
+func WithCoalesceInterval(d time.Duration) AggregatorOption {
+	return func(a *aggregator) {
+		a.coalesceInterval = d
+	}
+}
+
+// WithMaxPendingSnapshots overrides how many unconsumed snapshots the
+// aggregator will queue for a slow reader before dropping the oldest
+// ones. The default is defaultMaxPendingSnapshots.
+func WithMaxPendingSnapshots(n int) AggregatorOption {
+	return func(a *aggregator) {
+		a.maxPendingSnapshots = n
+	}
+}
+
+// WithEvents makes the aggregator report the lifecycle transitions it
+// goes through (Bootstrapped, ResolverAdded/Removed, ...) on events.
+// See Event for the full set of transitions and Work's Context().Done
+// case for the final one, ShuttingDown.
+func WithEvents(events chan<- Event) AggregatorOption {
+	return func(a *aggregator) {
+		a.events = events
+	}
+}
+
+// aggregator merges Kubernetes updates and the endpoints reported by
+// every resolver.Kind backend (Consul and otherwise) into watt
+// Snapshots, holding back the first snapshot until the bootstrap
+// condition is satisfied: every required Kubernetes kind has been
+// seen at least once, and every backend referenced by a resolver
+// ConfigMap has received at least one (possibly empty) endpoints
+// update.
+type aggregator struct {
+	KubernetesEvents  chan k8sEvent
+	ConsulEndpoints   chan consulwatch.Endpoints
+	ResolverEndpoints chan ResolverUpdate
+	ResyncRequests    chan int
+	StatusRequests    chan chan health.Status
+
+	snapshots chan<- string
+	watches   chan<- []WatchSpec
+	deltas    chan<- SnapshotUpdate
+	events    chan<- Event
+
+	requiredKinds map[string]bool
+
+	kubernetesResources map[string][]k8s.Resource
+	consulEndpoints     map[string]consulwatch.Endpoints
+	resolverEndpoints   map[backendKey]resolver.Endpoints
+	watchedBackends     map[backendKey]bool
+
+	bootstrapped bool
+	version      int
+	lastSnapshot *watt.Snapshot
+
+	// ctx is p.Context() from Work, stashed here so that emitEvent and
+	// publishDelta (both only ever called from Work's goroutine) can
+	// bail out of a blocked send once the aggregator is shutting down.
+	ctx context.Context
+
+	coalesceInterval    time.Duration
+	maxPendingSnapshots int
+	coalesceTimer       *time.Timer
+	pendingSnapshots    []string
+	dirty               bool
+}
+
+// NewAggregator creates an aggregator that publishes full snapshots
+// as JSON on snapshots and the current set of resolver ConfigMaps on
+// watches, holding back the first snapshot until requiredKinds have
+// all been seen.
+func NewAggregator(snapshots chan<- string, watches chan<- []WatchSpec, requiredKinds []string, opts ...AggregatorOption) *aggregator {
+	required := make(map[string]bool, len(requiredKinds))
+	for _, kind := range requiredKinds {
+		required[strings.ToLower(kind)] = true
+	}
+
+	a := &aggregator{
+		KubernetesEvents:  make(chan k8sEvent),
+		ConsulEndpoints:   make(chan consulwatch.Endpoints),
+		ResolverEndpoints: make(chan ResolverUpdate),
+		ResyncRequests:    make(chan int),
+		StatusRequests:    make(chan chan health.Status),
+
+		snapshots: snapshots,
+		watches:   watches,
+
+		requiredKinds: required,
+
+		kubernetesResources: make(map[string][]k8s.Resource),
+		consulEndpoints:     make(map[string]consulwatch.Endpoints),
+		resolverEndpoints:   make(map[backendKey]resolver.Endpoints),
+		watchedBackends:     make(map[backendKey]bool),
+
+		coalesceInterval:    defaultCoalesceInterval,
+		maxPendingSnapshots: defaultMaxPendingSnapshots,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+// Work runs the aggregator's main loop until its Process's context
+// is cancelled.
+func (a *aggregator) Work(p *supervisor.Process) error {
+	a.ctx = p.Context()
+
+	for {
+		// timerC is nil (and therefore disabled) whenever there is
+		// no coalesce window running, e.g. because nothing has
+		// changed since the last snapshot was queued.
+		var timerC <-chan time.Time
+		if a.coalesceTimer != nil {
+			timerC = a.coalesceTimer.C
+		}
+
+		// sendCh is nil (and therefore disabled) whenever there is
+		// nothing queued to send, so this case never fires unless
+		// there's an actual snapshot for a reader to consume.
+		var sendCh chan<- string
+		var next string
+		if len(a.pendingSnapshots) > 0 {
+			sendCh = a.snapshots
+			next = a.pendingSnapshots[0]
+		}
+
+		select {
+		case event := <-a.KubernetesEvents:
+			if _, resynced := a.kubernetesResources[event.kind]; resynced {
+				a.emitEvent(Event{Kind: EventKubernetesKindResynced, K8sKind: event.kind})
+			}
+			a.kubernetesResources[event.kind] = event.resources
+			a.updateWatches()
+			a.scheduleSnapshot()
+		case endpoints := <-a.ConsulEndpoints:
+			if _, ok := a.consulEndpoints[endpoints.Service]; !ok {
+				a.emitEvent(Event{Kind: EventConsulServiceFirstEndpoints, ResolverKind: resolver.Consul, Service: endpoints.Service})
+			}
+			a.consulEndpoints[endpoints.Service] = endpoints
+			a.scheduleSnapshot()
+		case update := <-a.ResolverEndpoints:
+			a.resolverEndpoints[backendKey{update.Kind, update.Endpoints.Service}] = update.Endpoints
+			a.scheduleSnapshot()
+		case baseVersion := <-a.ResyncRequests:
+			a.handleResync(baseVersion)
+		case reply := <-a.StatusRequests:
+			reply <- a.status()
+		case <-timerC:
+			a.coalesceTimer = nil
+			a.enqueueSnapshot(p)
+			a.dirty = false
+		case sendCh <- next:
+			a.pendingSnapshots = a.pendingSnapshots[1:]
+			if len(a.pendingSnapshots) > 0 {
+				break
+			}
+			if a.dirty {
+				// More changes piled up while the consumer was
+				// busy reading the last snapshot: don't make them
+				// wait out a whole new coalesce window.
+				if a.coalesceTimer != nil {
+					a.coalesceTimer.Stop()
+					a.coalesceTimer = nil
+				}
+				a.enqueueSnapshot(p)
+				a.dirty = false
+			} else {
+				a.coalesceTimer = nil
+			}
+		case <-p.Context().Done():
+			a.emitEvent(Event{
+				Kind:            EventShuttingDown,
+				Reason:          p.Context().Err().Error(),
+				InFlightWatches: len(a.watchedBackends),
+			})
+			return nil
+		}
+	}
+}
+
+// scheduleSnapshot marks the aggregator's state dirty and, once it is
+// bootstrapped, arms the coalesce timer if it isn't already running.
+func (a *aggregator) scheduleSnapshot() {
+	if !a.isBootstrapped() {
+		return
+	}
+	if !a.bootstrapped {
+		a.bootstrapped = true
+		a.emitEvent(Event{Kind: EventBootstrapped})
+	}
+	a.dirty = true
+	if a.coalesceTimer == nil {
+		a.coalesceTimer = time.NewTimer(a.coalesceInterval)
+	}
+}
+
+// emitEvent reports e on events, if a consumer asked for them via
+// WithEvents. It's a no-op otherwise. An event the consumer can take
+// without blocking is always delivered, even after the aggregator's
+// context is done (as it is for ShuttingDown); otherwise the send
+// gives up once that context is done, so that a stalled or already-
+// departed events consumer can never wedge Work.
+func (a *aggregator) emitEvent(e Event) {
+	if a.events == nil {
+		return
+	}
+	select {
+	case a.events <- e:
+		return
+	default:
+	}
+	select {
+	case a.events <- e:
+	case <-a.ctx.Done():
+	}
+}
+
+// updateWatches recomputes the set of resolver ConfigMaps (of every
+// kind in resolverAnnotations) and the backends they reference, and
+// pushes a WatchSpec per ConfigMap to the watches channel so the
+// watch manager can start or stop watches accordingly.
+func (a *aggregator) updateWatches() {
+	var specs []WatchSpec
+	backends := make(map[backendKey]bool)
+
+	for _, res := range a.kubernetesResources["configmap"] {
+		annotations := res.Annotations()
+		if annotations == nil {
+			continue
+		}
+		for annotation, kind := range resolverAnnotations {
+			if _, ok := annotations[annotation]; !ok {
+				continue
+			}
+			specs = append(specs, WatchSpec{ResolverKind: kind, ConfigMap: res})
+			if service := resolver.ServiceName(res); service != "" {
+				backends[backendKey{kind, service}] = true
+			}
+		}
+	}
+
+	for key := range backends {
+		if !a.watchedBackends[key] {
+			a.emitEvent(Event{Kind: EventResolverAdded, ResolverKind: key.kind, Service: key.service})
+		}
+	}
+	for key := range a.watchedBackends {
+		if !backends[key] {
+			a.emitEvent(Event{Kind: EventResolverRemoved, ResolverKind: key.kind, Service: key.service})
+		}
+	}
+
+	a.watchedBackends = backends
+	a.watches <- specs
+}
+
+// isBootstrapped reports whether every required Kubernetes kind and
+// every watched backend (of any resolver.Kind) has been seen at least
+// once.
+func (a *aggregator) isBootstrapped() bool {
+	for kind := range a.requiredKinds {
+		if _, ok := a.kubernetesResources[kind]; !ok {
+			return false
+		}
+	}
+	for key := range a.watchedBackends {
+		if key.kind == resolver.Consul {
+			if _, ok := a.consulEndpoints[key.service]; !ok {
+				return false
+			}
+			continue
+		}
+		if _, ok := a.resolverEndpoints[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *aggregator) buildSnapshot() *watt.Snapshot {
+	kube := make(map[string][]k8s.Resource, len(a.kubernetesResources))
+	for kind, resources := range a.kubernetesResources {
+		kube[kind] = resources
+	}
+
+	endpoints := make(map[string]consulwatch.Endpoints, len(a.consulEndpoints))
+	for service, e := range a.consulEndpoints {
+		endpoints[service] = e
+	}
+
+	resolvers := make(map[string]map[string]resolver.Endpoints)
+	for key, eps := range a.resolverEndpoints {
+		byService, ok := resolvers[string(key.kind)]
+		if !ok {
+			byService = make(map[string]resolver.Endpoints)
+			resolvers[string(key.kind)] = byService
+		}
+		byService[key.service] = eps
+	}
+
+	return &watt.Snapshot{
+		Kubernetes: kube,
+		Consul:     watt.ConsulSnapshot{Endpoints: endpoints},
+		Resolvers:  resolvers,
+	}
+}
+
+// enqueueSnapshot builds the current snapshot, queues it for delivery
+// on the snapshots channel (dropping the oldest queued snapshot if
+// the reader has fallen more than maxPendingSnapshots behind), and
+// publishes the corresponding delta, if any consumer asked for one.
+func (a *aggregator) enqueueSnapshot(p *supervisor.Process) {
+	snapshot := a.buildSnapshot()
+
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		p.Logf("failed to marshal snapshot: %v", err)
+		return
+	}
+
+	a.pendingSnapshots = append(a.pendingSnapshots, string(bytes))
+	if over := len(a.pendingSnapshots) - a.maxPendingSnapshots; over > 0 {
+		p.Logf("reader is falling behind, dropping %d queued snapshot(s)", over)
+		a.pendingSnapshots = a.pendingSnapshots[over:]
+		a.emitEvent(Event{Kind: EventSnapshotDropped, Count: over})
+	}
+
+	a.publishDelta(p, snapshot)
+}
+
+// publishDelta sends the first full SnapshotUpdate, or an incremental
+// one against the previous version, to any consumer that asked for
+// deltas via WithDeltas. The send gives up once the aggregator's
+// context is done, so a slow or absent deltas consumer can never
+// wedge the whole Work loop.
+func (a *aggregator) publishDelta(p *supervisor.Process, snapshot *watt.Snapshot) {
+	if a.deltas != nil {
+		update := SnapshotUpdate{Version: a.version + 1}
+		if a.lastSnapshot == nil {
+			update.Full = snapshot
+		} else if delta := diffSnapshots(a.lastSnapshot, snapshot); delta != nil {
+			update.BaseVersion = a.version
+			update.Delta = delta
+		} else {
+			a.lastSnapshot = snapshot
+			return
+		}
+		a.version = update.Version
+		select {
+		case a.deltas <- update:
+		case <-a.ctx.Done():
+		}
+	}
+
+	a.lastSnapshot = snapshot
+}
+
+// status builds a health.Status describing which required kinds and
+// which watched backends (Consul or otherwise) are still pending,
+// mirroring exactly the condition that gates the first snapshot
+// emission in isBootstrapped.
+func (a *aggregator) status() health.Status {
+	st := health.Status{}
+
+	for kind := range a.requiredKinds {
+		if _, ok := a.kubernetesResources[kind]; !ok {
+			st.PendingKinds = append(st.PendingKinds, kind)
+		}
+	}
+	for key := range a.watchedBackends {
+		if key.kind == resolver.Consul {
+			st.ConsulWatches = append(st.ConsulWatches, key.service)
+			if _, ok := a.consulEndpoints[key.service]; !ok {
+				st.PendingConsulServices = append(st.PendingConsulServices, key.service)
+			}
+			continue
+		}
+		if _, ok := a.resolverEndpoints[key]; !ok {
+			st.PendingResolverBackends = append(st.PendingResolverBackends, string(key.kind)+"/"+key.service)
+		}
+	}
+	sort.Strings(st.PendingKinds)
+	sort.Strings(st.PendingConsulServices)
+	sort.Strings(st.ConsulWatches)
+	sort.Strings(st.PendingResolverBackends)
+
+	st.Ready = len(st.PendingKinds) == 0 && len(st.PendingConsulServices) == 0 && len(st.PendingResolverBackends) == 0
+
+	if a.lastSnapshot != nil {
+		if bytes, err := json.Marshal(a.lastSnapshot); err == nil {
+			st.Snapshot = string(bytes)
+		}
+	}
+
+	return st
+}
+
+// Status implements health.StatusSource by asking the Work loop,
+// which owns all of the aggregator's state, for a status snapshot.
+// It is safe to call from any goroutine.
+func (a *aggregator) Status(ctx context.Context) (health.Status, error) {
+	reply := make(chan health.Status, 1)
+
+	select {
+	case a.StatusRequests <- reply:
+	case <-ctx.Done():
+		return health.Status{}, ctx.Err()
+	}
+
+	select {
+	case st := <-reply:
+		return st, nil
+	case <-ctx.Done():
+		return health.Status{}, ctx.Err()
+	}
+}
+
+// handleResync answers a consumer's request to resync from
+// baseVersion: if that's stale or unknown (anything but the current
+// version), it gets a full snapshot instead of a delta.
+func (a *aggregator) handleResync(baseVersion int) {
+	if a.deltas == nil || a.lastSnapshot == nil {
+		return
+	}
+	if baseVersion != a.version {
+		select {
+		case a.deltas <- SnapshotUpdate{Version: a.version, Full: a.lastSnapshot}:
+		case <-a.ctx.Done():
+		}
+	}
+}
+
+type resourceKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func indexResources(snapshot *watt.Snapshot) map[resourceKey]k8s.Resource {
+	index := make(map[resourceKey]k8s.Resource)
+	for kind, resources := range snapshot.Kubernetes {
+		for _, res := range resources {
+			index[resourceKey{kind, res.Namespace(), res.Name()}] = res
+		}
+	}
+	return index
+}
+
+func endpointsEqual(a, b consulwatch.Endpoints) bool {
+	if len(a.Endpoints) != len(b.Endpoints) {
+		return false
+	}
+	for i := range a.Endpoints {
+		if a.Endpoints[i] != b.Endpoints[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func resolverEndpointsEqual(a, b resolver.Endpoints) bool {
+	if len(a.Endpoints) != len(b.Endpoints) {
+		return false
+	}
+	for i := range a.Endpoints {
+		if a.Endpoints[i].Address != b.Endpoints[i].Address || a.Endpoints[i].Port != b.Endpoints[i].Port {
+			return false
+		}
+		if len(a.Endpoints[i].Metadata) != len(b.Endpoints[i].Metadata) {
+			return false
+		}
+		for k, v := range a.Endpoints[i].Metadata {
+			if b.Endpoints[i].Metadata[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// diffSnapshots computes the SnapshotDelta between prev and curr, or
+// nil if it is empty. Kubernetes resources are compared by
+// kind+namespace+name only: a resource whose content changed under the
+// same key is not reported, and a change of only that sort yields nil.
+func diffSnapshots(prev, curr *watt.Snapshot) *SnapshotDelta {
+	prevIndex := indexResources(prev)
+	currIndex := indexResources(curr)
+
+	delta := &SnapshotDelta{
+		K8sAdds:                 make(map[string][]k8s.Resource),
+		K8sDeletes:              make(map[string][]ResourceRef),
+		ConsulEndpointChanges:   make(map[string]*consulwatch.Endpoints),
+		ResolverEndpointChanges: make(map[string]map[string]*resolver.Endpoints),
+	}
+
+	for key, res := range currIndex {
+		if _, ok := prevIndex[key]; !ok {
+			delta.K8sAdds[key.kind] = append(delta.K8sAdds[key.kind], res)
+		}
+	}
+	for key := range prevIndex {
+		if _, ok := currIndex[key]; !ok {
+			delta.K8sDeletes[key.kind] = append(delta.K8sDeletes[key.kind], ResourceRef{
+				Kind:      key.kind,
+				Namespace: key.namespace,
+				Name:      key.name,
+			})
+		}
+	}
+
+	for service, endpoints := range curr.Consul.Endpoints {
+		old, existed := prev.Consul.Endpoints[service]
+		if !existed || !endpointsEqual(old, endpoints) {
+			e := endpoints
+			delta.ConsulEndpointChanges[service] = &e
+		}
+	}
+	for service := range prev.Consul.Endpoints {
+		if _, ok := curr.Consul.Endpoints[service]; !ok {
+			delta.ConsulEndpointChanges[service] = nil
+		}
+	}
+
+	for kind, byService := range curr.Resolvers {
+		for service, eps := range byService {
+			old, existed := prev.Resolvers[kind][service]
+			if !existed || !resolverEndpointsEqual(old, eps) {
+				if delta.ResolverEndpointChanges[kind] == nil {
+					delta.ResolverEndpointChanges[kind] = make(map[string]*resolver.Endpoints)
+				}
+				e := eps
+				delta.ResolverEndpointChanges[kind][service] = &e
+			}
+		}
+	}
+	for kind, byService := range prev.Resolvers {
+		for service := range byService {
+			if _, ok := curr.Resolvers[kind][service]; !ok {
+				if delta.ResolverEndpointChanges[kind] == nil {
+					delta.ResolverEndpointChanges[kind] = make(map[string]*resolver.Endpoints)
+				}
+				delta.ResolverEndpointChanges[kind][service] = nil
+			}
+		}
+	}
+
+	if len(delta.K8sAdds) == 0 && len(delta.K8sDeletes) == 0 && len(delta.ConsulEndpointChanges) == 0 && len(delta.ResolverEndpointChanges) == 0 {
+		return nil
+	}
+	return delta
+}
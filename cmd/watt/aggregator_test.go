@@ -11,12 +11,13 @@ import (
 	"github.com/datawire/teleproxy/pkg/watt"
 
 	"github.com/datawire/teleproxy/pkg/k8s"
+	"github.com/datawire/teleproxy/pkg/resolver"
 	"github.com/datawire/teleproxy/pkg/supervisor"
 )
 
 type aggIsolator struct {
 	snapshots  chan string
-	watches    chan []k8s.Resource
+	watches    chan []WatchSpec
 	aggregator *aggregator
 	sup        *supervisor.Supervisor
 	done       chan struct{}
@@ -24,7 +25,7 @@ type aggIsolator struct {
 	cancel     context.CancelFunc
 }
 
-func newAggIsolator(t *testing.T, requiredKinds []string) *aggIsolator {
+func newAggIsolator(t *testing.T, requiredKinds []string, opts ...AggregatorOption) *aggIsolator {
 	// aggregator uses zero length channels for its inputs so we can
 	// control the total ordering of all inputs and therefore
 	// intentionally trigger any order of events we want to test
@@ -32,12 +33,12 @@ func newAggIsolator(t *testing.T, requiredKinds []string) *aggIsolator {
 		// we need to create buffered channels for outputs
 		// because nothing is asynchronously reading them in
 		// the test
-		watches:   make(chan []k8s.Resource, 100),
+		watches:   make(chan []WatchSpec, 100),
 		snapshots: make(chan string, 100),
 		// for signaling when the isolator is done
 		done: make(chan struct{}),
 	}
-	iso.aggregator = NewAggregator(iso.snapshots, iso.watches, requiredKinds)
+	iso.aggregator = NewAggregator(iso.snapshots, iso.watches, requiredKinds, opts...)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	iso.cancel = cancel
 	iso.sup = supervisor.WithContext(ctx)
@@ -49,8 +50,8 @@ func newAggIsolator(t *testing.T, requiredKinds []string) *aggIsolator {
 	return iso
 }
 
-func startAggIsolator(t *testing.T, requiredKinds []string) *aggIsolator {
-	iso := newAggIsolator(t, requiredKinds)
+func startAggIsolator(t *testing.T, requiredKinds []string, opts ...AggregatorOption) *aggIsolator {
+	iso := newAggIsolator(t, requiredKinds, opts...)
 	iso.Start()
 	return iso
 }
@@ -106,6 +107,17 @@ data:
   consulAddress: "127.0.0.1:8500"
   datacenter: "dc1"
   service: "bar"
+`)
+	DNS_SRV_RESOLVER = resources(`
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: baz
+  annotations:
+    "getambassador.io/dns-srv-resolver": "true"
+data:
+  service: "baz"
 `)
 )
 
@@ -131,7 +143,7 @@ func TestAggregatorBootstrap(t *testing.T) {
 	// whenever the aggregator sees updated k8s state, it should
 	// send an update to the consul watch manager, in this case it
 	// will be empty because there are no resolvers yet
-	expect(t, iso.watches, []k8s.Resource(nil))
+	expect(t, iso.watches, []WatchSpec(nil))
 
 	// we should not generate a snapshot yet because we specified
 	// configmaps are required
@@ -141,12 +153,16 @@ func TestAggregatorBootstrap(t *testing.T) {
 	// get a snapshot yet, but we should get watches
 	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", RESOLVER}
 	expect(t, iso.snapshots, Timeout(100*time.Millisecond))
-	expect(t, iso.watches, func(watches []k8s.Resource) bool {
+	expect(t, iso.watches, func(watches []WatchSpec) bool {
 		if len(watches) != 1 {
 			return false
 		}
 
-		if watches[0].Name() != "bar" {
+		if watches[0].ResolverKind != resolver.Consul {
+			return false
+		}
+
+		if watches[0].ConfigMap.Name() != "bar" {
 			return false
 		}
 
@@ -176,3 +192,336 @@ func TestAggregatorBootstrap(t *testing.T) {
 		return ok
 	})
 }
+
+// Bootstrap gating isn't specific to Consul: a dns-srv-resolver
+// ConfigMap should hold back the snapshot until its backend has
+// reported endpoints too, the same way a consul-resolver does.
+func TestAggregatorBootstrapPerBackend(t *testing.T) {
+	iso := startAggIsolator(t, []string{"service", "configmap"})
+	defer iso.Stop()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", DNS_SRV_RESOLVER}
+	expect(t, iso.watches, func(watches []WatchSpec) bool {
+		return len(watches) == 1 &&
+			watches[0].ResolverKind == resolver.DNSSRV &&
+			watches[0].ConfigMap.Name() == "baz"
+	})
+
+	// the dns-srv backend hasn't reported endpoints yet
+	expect(t, iso.snapshots, Timeout(100*time.Millisecond))
+
+	iso.aggregator.ResolverEndpoints <- ResolverUpdate{
+		Kind:      resolver.DNSSRV,
+		Endpoints: resolver.Endpoints{Service: "baz"},
+	}
+
+	expect(t, iso.snapshots, func(snapshot string) bool {
+		s := &watt.Snapshot{}
+		if err := json.Unmarshal([]byte(snapshot), s); err != nil {
+			return false
+		}
+		_, ok := s.Resolvers["dns-srv"]["baz"]
+		return ok
+	})
+}
+
+// Status should reflect exactly what's still blocking bootstrap, and
+// flip to Ready once TestAggregatorBootstrap's scenario completes.
+func TestAggregatorStatus(t *testing.T) {
+	iso := startAggIsolator(t, []string{"service", "configmap"})
+	defer iso.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	status, err := iso.aggregator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Ready {
+		t.Errorf("expected not ready before any kubernetes state has been seen")
+	}
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", RESOLVER}
+	expect(t, iso.watches, func(watches []WatchSpec) bool { return len(watches) == 1 })
+
+	status, err = iso.aggregator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Ready {
+		t.Errorf("expected not ready until the bar consul service has endpoints")
+	}
+	if len(status.PendingConsulServices) != 1 || status.PendingConsulServices[0] != "bar" {
+		t.Errorf("expected bar pending, got %v", status.PendingConsulServices)
+	}
+
+	iso.aggregator.ConsulEndpoints <- consulwatch.Endpoints{Service: "bar"}
+	expect(t, iso.snapshots, func(snapshot string) bool { return len(snapshot) > 0 })
+
+	status, err = iso.aggregator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Ready {
+		t.Errorf("expected ready once all required kinds and consul services have been seen")
+	}
+	if status.Snapshot == "" {
+		t.Errorf("expected the last snapshot to be reported once bootstrapped")
+	}
+}
+
+// Status gating isn't specific to Consul: a pending dns-srv backend
+// should hold Ready at false and show up in PendingResolverBackends,
+// the same way a pending Consul service does.
+func TestAggregatorStatusPerBackend(t *testing.T) {
+	iso := startAggIsolator(t, []string{"service", "configmap"})
+	defer iso.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", DNS_SRV_RESOLVER}
+	expect(t, iso.watches, func(watches []WatchSpec) bool { return len(watches) == 1 })
+
+	status, err := iso.aggregator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Ready {
+		t.Errorf("expected not ready until the baz dns-srv backend has endpoints")
+	}
+	if len(status.PendingResolverBackends) != 1 || status.PendingResolverBackends[0] != "dns-srv/baz" {
+		t.Errorf("expected dns-srv/baz pending, got %v", status.PendingResolverBackends)
+	}
+
+	iso.aggregator.ResolverEndpoints <- ResolverUpdate{
+		Kind:      resolver.DNSSRV,
+		Endpoints: resolver.Endpoints{Service: "baz"},
+	}
+	expect(t, iso.snapshots, func(snapshot string) bool { return len(snapshot) > 0 })
+
+	status, err = iso.aggregator.Status(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Ready {
+		t.Errorf("expected ready once the dns-srv backend has reported endpoints")
+	}
+	if len(status.PendingResolverBackends) != 0 {
+		t.Errorf("expected no pending resolver backends, got %v", status.PendingResolverBackends)
+	}
+}
+
+// Back-to-back updates that land within a single coalesce window
+// should only produce one snapshot, not one per update.
+func TestAggregatorCoalescesBackToBackUpdates(t *testing.T) {
+	iso := startAggIsolator(t, nil, WithCoalesceInterval(50*time.Millisecond))
+	defer iso.Stop()
+
+	for i := 0; i < 5; i++ {
+		iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+		expect(t, iso.watches, []WatchSpec(nil))
+	}
+
+	expect(t, iso.snapshots, func(snapshot string) bool {
+		return len(snapshot) > 0
+	})
+	// the five updates above should have coalesced into the single
+	// snapshot we just consumed, so nothing more should be pending
+	expect(t, iso.snapshots, Timeout(150*time.Millisecond))
+}
+
+// The bootstrap scenario from TestAggregatorBootstrap should emit
+// exactly: the resolver being added once its ConfigMap shows up, the
+// consul service's first endpoints, and then Bootstrapped once those
+// endpoints satisfy the last pending backend.
+func TestAggregatorBootstrapEvents(t *testing.T) {
+	events := make(chan Event, 100)
+	iso := startAggIsolator(t, []string{"service", "configmap"}, WithEvents(events))
+	defer iso.Stop()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", RESOLVER}
+	expect(t, events, Event{Kind: EventResolverAdded, ResolverKind: resolver.Consul, Service: "bar"})
+
+	iso.aggregator.ConsulEndpoints <- consulwatch.Endpoints{
+		Service: "bar",
+		Endpoints: []consulwatch.Endpoint{
+			{Service: "bar", Address: "1.2.3.4", Port: 80},
+		},
+	}
+	expect(t, events, Event{Kind: EventConsulServiceFirstEndpoints, ResolverKind: resolver.Consul, Service: "bar"})
+	expect(t, events, Event{Kind: EventBootstrapped})
+	expect(t, events, Timeout(100*time.Millisecond))
+}
+
+// Once bootstrapped, removing the resolver ConfigMap should resync the
+// configmap kind and then report the consul backend as removed.
+func TestAggregatorResolverRemovalEvents(t *testing.T) {
+	events := make(chan Event, 100)
+	iso := startAggIsolator(t, []string{"service", "configmap"}, WithEvents(events))
+	defer iso.Stop()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", RESOLVER}
+	expect(t, events, Event{Kind: EventResolverAdded, ResolverKind: resolver.Consul, Service: "bar"})
+
+	iso.aggregator.ConsulEndpoints <- consulwatch.Endpoints{Service: "bar"}
+	expect(t, events, Event{Kind: EventConsulServiceFirstEndpoints, ResolverKind: resolver.Consul, Service: "bar"})
+	expect(t, events, Event{Kind: EventBootstrapped})
+
+	// the configmap is gone, so the backend it referenced goes away too
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", nil}
+	expect(t, events, Event{Kind: EventKubernetesKindResynced, K8sKind: "configmap"})
+	expect(t, events, Event{Kind: EventResolverRemoved, ResolverKind: resolver.Consul, Service: "bar"})
+	expect(t, events, Timeout(100*time.Millisecond))
+}
+
+// When the reader isn't keeping up, the aggregator should drop the
+// oldest queued snapshots rather than deadlock waiting for it.
+func TestAggregatorDropsOldestSnapshotsWhenReaderStalls(t *testing.T) {
+	snapshots := make(chan string) // unbuffered: nobody is draining it yet
+	watches := make(chan []WatchSpec, 100)
+
+	agg := NewAggregator(snapshots, watches, nil, WithCoalesceInterval(5*time.Millisecond), WithMaxPendingSnapshots(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	sup := supervisor.WithContext(ctx)
+	sup.Supervise(&supervisor.Worker{Name: "aggregator", Work: agg.Work})
+	go sup.Run()
+
+	// let five separate coalesce windows elapse without ever reading
+	// from snapshots, so the aggregator has to drop older ones
+	for i := 0; i < 5; i++ {
+		agg.KubernetesEvents <- k8sEvent{"service", SERVICES}
+		<-watches
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	count := 0
+	for {
+		select {
+		case <-snapshots:
+			count++
+		case <-time.After(100 * time.Millisecond):
+			if count > 2 {
+				t.Errorf("expected at most 2 queued snapshots, got %d", count)
+			}
+			return
+		}
+	}
+}
+
+// WithDeltas should publish a full SnapshotUpdate for the first
+// snapshot and then incremental deltas for later changes, for both
+// Consul and non-Consul backends. The dns-srv step checks that
+// non-Consul endpoints are reported in ResolverEndpointChanges.
+func TestAggregatorDeltas(t *testing.T) {
+	deltas := make(chan SnapshotUpdate, 100)
+	iso := startAggIsolator(t, []string{"service", "configmap"}, WithDeltas(deltas))
+	defer iso.Stop()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", RESOLVER}
+	expect(t, iso.watches, func(watches []WatchSpec) bool { return len(watches) == 1 })
+
+	iso.aggregator.ConsulEndpoints <- consulwatch.Endpoints{
+		Service:   "bar",
+		Endpoints: []consulwatch.Endpoint{{Service: "bar", Address: "1.2.3.4", Port: 80}},
+	}
+	expect(t, iso.snapshots, func(snapshot string) bool { return len(snapshot) > 0 })
+
+	update := <-deltas
+	if update.Version != 1 || update.BaseVersion != 0 || update.Full == nil {
+		t.Fatalf("expected the first update to be a full snapshot at version 1, got %#v", update)
+	}
+
+	// a Consul-only change should produce an incremental delta
+	iso.aggregator.ConsulEndpoints <- consulwatch.Endpoints{
+		Service:   "bar",
+		Endpoints: []consulwatch.Endpoint{{Service: "bar", Address: "5.6.7.8", Port: 80}},
+	}
+	expect(t, iso.snapshots, func(snapshot string) bool { return len(snapshot) > 0 })
+
+	update = <-deltas
+	if update.Delta == nil || update.Delta.ConsulEndpointChanges["bar"] == nil {
+		t.Fatalf("expected an incremental delta reporting bar's new endpoints, got %#v", update)
+	}
+	if len(update.Delta.ResolverEndpointChanges) != 0 {
+		t.Errorf("expected no resolver endpoint changes, got %v", update.Delta.ResolverEndpointChanges)
+	}
+
+	// adding a dns-srv resolver holds the snapshot back again (its
+	// backend is watched but hasn't reported endpoints), so no delta yet
+	iso.aggregator.KubernetesEvents <- k8sEvent{"configmap", append(RESOLVER, DNS_SRV_RESOLVER...)}
+	expect(t, iso.watches, func(watches []WatchSpec) bool { return len(watches) == 2 })
+	expect(t, iso.snapshots, Timeout(100*time.Millisecond))
+
+	// giving it endpoints should produce an incremental delta with
+	// ResolverEndpointChanges, not a dropped (nil) delta
+	iso.aggregator.ResolverEndpoints <- ResolverUpdate{
+		Kind: resolver.DNSSRV,
+		Endpoints: resolver.Endpoints{
+			Service:   "baz",
+			Endpoints: []resolver.Endpoint{{Address: "9.9.9.9", Port: 53}},
+		},
+	}
+	expect(t, iso.snapshots, func(snapshot string) bool {
+		s := &watt.Snapshot{}
+		if err := json.Unmarshal([]byte(snapshot), s); err != nil {
+			return false
+		}
+		_, ok := s.Resolvers["dns-srv"]["baz"]
+		return ok
+	})
+
+	update = <-deltas
+	if update.Delta == nil {
+		t.Fatalf("expected an incremental delta for the new dns-srv endpoints, got a nil delta")
+	}
+	changes, ok := update.Delta.ResolverEndpointChanges["dns-srv"]
+	if !ok || changes["baz"] == nil || changes["baz"].Service != "baz" {
+		t.Errorf("expected a dns-srv/baz endpoint change, got %#v", update.Delta.ResolverEndpointChanges)
+	}
+}
+
+// A resync request for a stale or unknown BaseVersion should get a
+// full snapshot; a resync already at the current version should get
+// nothing.
+func TestAggregatorResync(t *testing.T) {
+	deltas := make(chan SnapshotUpdate, 100)
+	iso := startAggIsolator(t, nil, WithDeltas(deltas))
+	defer iso.Stop()
+
+	iso.aggregator.KubernetesEvents <- k8sEvent{"service", SERVICES}
+	expect(t, iso.watches, []WatchSpec(nil))
+	expect(t, iso.snapshots, func(snapshot string) bool { return len(snapshot) > 0 })
+
+	update := <-deltas
+	if update.Version != 1 || update.Full == nil {
+		t.Fatalf("expected the first update to be a full snapshot at version 1, got %#v", update)
+	}
+
+	iso.aggregator.ResyncRequests <- 0
+	resync := <-deltas
+	if resync.Version != 1 || resync.Full == nil {
+		t.Errorf("expected a full resync at the current version, got %#v", resync)
+	}
+
+	iso.aggregator.ResyncRequests <- 1
+	expect(t, deltas, Timeout(100*time.Millisecond))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Timeout is a special expect() value meaning: assert that nothing
+// arrives on the channel within d.
+type Timeout time.Duration
+
+// expect asserts that the next value received on ch (which must be a
+// channel) satisfies want, which is either a Timeout, a predicate
+// func(T) bool, or a concrete value to compare with
+// reflect.DeepEqual.
+func expect(t *testing.T, ch interface{}, want interface{}) {
+	t.Helper()
+
+	chVal := reflect.ValueOf(ch)
+
+	if timeout, ok := want.(Timeout); ok {
+		chosen, recv, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: chVal},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(time.Duration(timeout)))},
+		})
+		if chosen == 0 {
+			t.Errorf("expected no value within %v, got %#v", time.Duration(timeout), recv.Interface())
+		}
+		return
+	}
+
+	chosen, recv, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: chVal},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(5 * time.Second))},
+	})
+	if chosen == 1 {
+		t.Errorf("timed out waiting for a value")
+		return
+	}
+	if !ok {
+		t.Errorf("channel closed unexpectedly")
+		return
+	}
+
+	matcher := reflect.ValueOf(want)
+	if matcher.Kind() == reflect.Func {
+		if !matcher.Call([]reflect.Value{recv})[0].Bool() {
+			t.Errorf("unexpected value: %#v", recv.Interface())
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(recv.Interface(), want) {
+		t.Errorf("expected %#v, got %#v", want, recv.Interface())
+	}
+}
@@ -0,0 +1,18 @@
+// Package consulwatch contains the types shared between watt's Consul
+// watch manager and its consumers.
+package consulwatch
+
+// Endpoint is a single instance of a Consul service, as reported by a
+// health check watch.
+type Endpoint struct {
+	Service string
+	Address string
+	Port    int
+}
+
+// Endpoints is a snapshot of all the instances currently registered
+// and passing health checks for a single Consul service.
+type Endpoints struct {
+	Service   string
+	Endpoints []Endpoint
+}
@@ -0,0 +1,120 @@
+// Package health exposes the bootstrap/readiness state of a watt
+// aggregator over HTTP, so that it's observable operationally instead
+// of only inferable from logs.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/datawire/teleproxy/pkg/supervisor"
+)
+
+// Status is a point-in-time snapshot of an aggregator's bootstrap
+// state.
+type Status struct {
+	Ready                   bool     `json:"ready"`
+	PendingKinds            []string `json:"pendingKinds,omitempty"`
+	PendingConsulServices   []string `json:"pendingConsulServices,omitempty"`
+	ConsulWatches           []string `json:"consulWatches,omitempty"`
+	// PendingResolverBackends lists the non-Consul backends (formatted
+	// as "<resolver.Kind>/<service>") that are watched but haven't
+	// reported endpoints yet.
+	PendingResolverBackends []string `json:"pendingResolverBackends,omitempty"`
+	// Snapshot is the last snapshot the aggregator emitted, as raw
+	// JSON, or "" if it hasn't bootstrapped yet.
+	Snapshot string `json:"-"`
+}
+
+// StatusSource is anything that can report its current bootstrap
+// status. watt's aggregator implements this.
+type StatusSource interface {
+	Status(ctx context.Context) (Status, error)
+}
+
+// Server serves /healthz, /readyz, and /debug/state for a
+// StatusSource.
+type Server struct {
+	addr   string
+	source StatusSource
+}
+
+// NewHealthServer creates a Server that, once supervised, listens on
+// addr and reports on source's bootstrap status.
+func NewHealthServer(addr string, source StatusSource) *Server {
+	return &Server{addr: addr, source: source}
+}
+
+// Work runs the health server until p's context is cancelled. It is
+// meant to be supervised alongside the aggregator Worker it reports
+// on.
+func (s *Server) Work(p *supervisor.Process) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/debug/state", s.handleDebugState)
+
+	httpServer := &http.Server{Addr: s.addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- httpServer.ListenAndServe() }()
+
+	select {
+	case <-p.Context().Done():
+		return httpServer.Close()
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	}
+}
+
+// handleHealthz always reports healthy: once the process is up and
+// serving requests at all, there's nothing further to check here.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleReadyz reports 200 only once the aggregator has bootstrapped
+// (every required kind seen and every watched backend, Consul or
+// otherwise, has at least one endpoints update), and 503 with the
+// pending kinds/services otherwise.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status, err := s.source.Status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleDebugState dumps the last snapshot the aggregator emitted and
+// the set of Consul services it currently has watches on.
+func (s *Server) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	status, err := s.source.Status(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	snapshot := json.RawMessage(status.Snapshot)
+	if len(snapshot) == 0 {
+		snapshot = json.RawMessage("null")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Snapshot      json.RawMessage `json:"snapshot"`
+		ConsulWatches []string        `json:"consulWatches,omitempty"`
+	}{
+		Snapshot:      snapshot,
+		ConsulWatches: status.ConsulWatches,
+	})
+}
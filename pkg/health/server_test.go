@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeSource struct {
+	status Status
+	err    error
+}
+
+func (f fakeSource) Status(ctx context.Context) (Status, error) {
+	return f.status, f.err
+}
+
+func TestReadyzReportsNotReadyWithPending(t *testing.T) {
+	source := fakeSource{status: Status{
+		Ready:                 false,
+		PendingKinds:          []string{"configmap"},
+		PendingConsulServices: []string{"bar"},
+	}}
+	s := NewHealthServer(":0", source)
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rec := httptest.NewRecorder()
+	s.handleReadyz(rec, req)
+
+	if rec.Code != 503 {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+
+	var got Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected body: %v", err)
+	}
+	if len(got.PendingKinds) != 1 || got.PendingKinds[0] != "configmap" {
+		t.Errorf("expected pending kind configmap, got %v", got.PendingKinds)
+	}
+}
+
+func TestReadyzReportsReady(t *testing.T) {
+	source := fakeSource{status: Status{Ready: true}}
+	s := NewHealthServer(":0", source)
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rec := httptest.NewRecorder()
+	s.handleReadyz(rec, req)
+
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestDebugStateDumpsSnapshotAndWatches(t *testing.T) {
+	source := fakeSource{status: Status{
+		Ready:         true,
+		ConsulWatches: []string{"bar"},
+		Snapshot:      `{"Kubernetes":{},"Consul":{"Endpoints":{}}}`,
+	}}
+	s := NewHealthServer(":0", source)
+
+	req := httptest.NewRequest("GET", "/debug/state", nil)
+	rec := httptest.NewRecorder()
+	s.handleDebugState(rec, req)
+
+	var got struct {
+		Snapshot      json.RawMessage
+		ConsulWatches []string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("unexpected body: %v", err)
+	}
+	if len(got.ConsulWatches) != 1 || got.ConsulWatches[0] != "bar" {
+		t.Errorf("expected consul watch bar, got %v", got.ConsulWatches)
+	}
+	if len(got.Snapshot) == 0 {
+		t.Errorf("expected a snapshot to be dumped")
+	}
+}
@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Resource is a generic representation of a Kubernetes resource as
+// decoded from JSON or YAML. We deliberately avoid generated types
+// here so that watt can work with any kind of resource, including
+// ones it doesn't know about in advance (e.g. CRDs).
+type Resource map[string]interface{}
+
+// Kind returns the resource's "kind" field, e.g. "Service" or
+// "ConfigMap".
+func (r Resource) Kind() string {
+	return r.str("kind")
+}
+
+// Name returns the resource's metadata.name field.
+func (r Resource) Name() string {
+	return r.metadataStr("name")
+}
+
+// Namespace returns the resource's metadata.namespace field,
+// defaulting to "default" the way Kubernetes does.
+func (r Resource) Namespace() string {
+	if ns := r.metadataStr("namespace"); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+// Annotations returns the resource's metadata.annotations, or nil if
+// it has none.
+func (r Resource) Annotations() map[string]interface{} {
+	metadata, ok := r["metadata"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return annotations
+}
+
+func (r Resource) str(key string) string {
+	v, _ := r[key].(string)
+	return v
+}
+
+func (r Resource) metadataStr(key string) string {
+	metadata, ok := r["metadata"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	v, _ := metadata[key].(string)
+	return v
+}
+
+// ParseResources decodes a multi-document YAML (or JSON, which is a
+// YAML subset) stream into a slice of Resources. The name is only
+// used to produce useful error messages.
+func ParseResources(name, input string) ([]Resource, error) {
+	var result []Resource
+
+	decoder := yaml.NewDecoder(strings.NewReader(input))
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if doc == nil {
+			continue
+		}
+		result = append(result, Resource(cleanupYAML(doc).(map[string]interface{})))
+	}
+
+	return result, nil
+}
+
+// cleanupYAML recursively converts the map[interface{}]interface{}
+// values that yaml.v2 produces for nested mappings into
+// map[string]interface{}, so that the rest of watt (and
+// encoding/json, which chokes on map[interface{}]interface{}) only
+// ever has to deal with one map type.
+func cleanupYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprintf("%v", key)] = cleanupYAML(val)
+		}
+		return m
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = cleanupYAML(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = cleanupYAML(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
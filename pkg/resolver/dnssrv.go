@@ -0,0 +1,84 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const defaultDNSSRVInterval = 30 * time.Second
+
+// DNSSRVResolver resolves a service by periodically issuing a DNS SRV
+// lookup for its name.
+type DNSSRVResolver struct {
+	// Interval is how often to repeat the lookup. Defaults to
+	// defaultDNSSRVInterval.
+	Interval time.Duration
+
+	// lookup is overridable so tests don't need a live resolver.
+	lookup func(service string) ([]*net.SRV, error)
+}
+
+// NewDNSSRVResolver creates a DNSSRVResolver using the system
+// resolver with the default lookup interval.
+func NewDNSSRVResolver() *DNSSRVResolver {
+	return &DNSSRVResolver{
+		Interval: defaultDNSSRVInterval,
+		lookup: func(service string) ([]*net.SRV, error) {
+			_, srvs, err := net.LookupSRV("", "", service)
+			return srvs, err
+		},
+	}
+}
+
+func (r *DNSSRVResolver) Kind() Kind {
+	return DNSSRV
+}
+
+// Watch issues an immediate SRV lookup and then repeats it every
+// Interval until ctx is done, pushing the latest result each time.
+// A lookup error is discarded without being logged or reported, and
+// simply skips that cycle.
+func (r *DNSSRVResolver) Watch(ctx context.Context, spec Spec) (<-chan Endpoints, error) {
+	service := ServiceName(spec.ConfigMap)
+	out := make(chan Endpoints)
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultDNSSRVInterval
+	}
+
+	go func() {
+		defer close(out)
+
+		poll := func() {
+			srvs, err := r.lookup(service)
+			if err != nil {
+				return
+			}
+			endpoints := make([]Endpoint, len(srvs))
+			for i, srv := range srvs {
+				endpoints[i] = Endpoint{Address: srv.Target, Port: int(srv.Port)}
+			}
+			select {
+			case out <- Endpoints{Service: service, Endpoints: endpoints}:
+			case <-ctx.Done():
+			}
+		}
+
+		poll()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				poll()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"context"
+
+	"github.com/datawire/teleproxy/pkg/k8s"
+)
+
+// EndpointSliceResolver watches Kubernetes discovery.k8s.io/v1
+// EndpointSlice resources for a service.
+type EndpointSliceResolver struct {
+	// WatchFunc does the actual API-server watch: given a namespace
+	// and service name, it streams the EndpointSlice resources
+	// currently selecting that service every time they change. It's
+	// a field, rather than a dependency baked into this type,
+	// so tests can fake the API server.
+	WatchFunc func(ctx context.Context, namespace, service string) (<-chan []k8s.Resource, error)
+}
+
+func (r *EndpointSliceResolver) Kind() Kind {
+	return EndpointSlice
+}
+
+func (r *EndpointSliceResolver) Watch(ctx context.Context, spec Spec) (<-chan Endpoints, error) {
+	service := ServiceName(spec.ConfigMap)
+	namespace := spec.ConfigMap.Namespace()
+
+	slices, err := r.WatchFunc(ctx, namespace, service)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Endpoints)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case resources, ok := <-slices:
+				if !ok {
+					return
+				}
+				select {
+				case out <- endpointsFromSlices(service, resources):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// endpointsFromSlices flattens the addresses of every endpoint in
+// every slice into a single Endpoints, using the first port entry
+// each slice declares (watt doesn't yet support per-port routing).
+func endpointsFromSlices(service string, slices []k8s.Resource) Endpoints {
+	var endpoints []Endpoint
+
+	for _, slice := range slices {
+		port := 0
+		if ports, ok := slice["ports"].([]interface{}); ok && len(ports) > 0 {
+			if p, ok := ports[0].(map[string]interface{}); ok {
+				if n, ok := p["port"].(int); ok {
+					port = n
+				}
+			}
+		}
+
+		entries, _ := slice["endpoints"].([]interface{})
+		for _, entry := range entries {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			addresses, _ := fields["addresses"].([]interface{})
+			for _, addr := range addresses {
+				address, ok := addr.(string)
+				if !ok {
+					continue
+				}
+				endpoints = append(endpoints, Endpoint{Address: address, Port: port})
+			}
+		}
+	}
+
+	return Endpoints{Service: service, Endpoints: endpoints}
+}
@@ -0,0 +1,62 @@
+// Package resolver defines the pluggable interface watt uses to
+// watch endpoints for a service from a backend other than its
+// built-in Consul support, plus the backends themselves.
+package resolver
+
+import (
+	"context"
+
+	"github.com/datawire/teleproxy/pkg/k8s"
+)
+
+// Kind identifies a resolver backend, e.g. "dns-srv".
+type Kind string
+
+const (
+	Consul        Kind = "consul"
+	DNSSRV        Kind = "dns-srv"
+	EndpointSlice Kind = "endpointslice"
+)
+
+// Endpoint is a single resolved backend instance.
+type Endpoint struct {
+	Address string
+	Port    int
+	// Metadata carries backend-specific extra data that callers who
+	// understand Kind can make use of. DNSSRVResolver and
+	// EndpointSliceResolver leave it nil.
+	Metadata map[string]string
+}
+
+// Endpoints is a snapshot of all the instances currently known for
+// one service, as reported by one Resolver.
+type Endpoints struct {
+	Service   string
+	Endpoints []Endpoint
+}
+
+// Spec is everything a Resolver needs in order to watch one backend:
+// the ConfigMap that configured it.
+type Spec struct {
+	ConfigMap k8s.Resource
+}
+
+// Resolver is a pluggable backend that can watch a service's
+// endpoints. DNSSRVResolver and EndpointSliceResolver implement it;
+// Consul has a Kind here but no Resolver in this package.
+type Resolver interface {
+	Kind() Kind
+	Watch(ctx context.Context, spec Spec) (<-chan Endpoints, error)
+}
+
+// ServiceName reads the "service" field out of a resolver ConfigMap's
+// data, which is how all of watt's built-in resolver kinds name the
+// service they watch.
+func ServiceName(configMap k8s.Resource) string {
+	data, ok := configMap["data"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	service, _ := data["service"].(string)
+	return service
+}
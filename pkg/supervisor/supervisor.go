@@ -0,0 +1,92 @@
+// Package supervisor runs a set of named, long-lived workers and
+// coordinates their shutdown.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Worker is a named unit of work. Work runs until it returns, until
+// its Process's context is cancelled, or until the owning
+// Supervisor is shut down.
+type Worker struct {
+	Name string
+	Work func(p *Process) error
+}
+
+// Process is the handle a Worker's Work function uses to talk back
+// to its Supervisor.
+type Process struct {
+	ctx  context.Context
+	name string
+}
+
+// Context returns the Process's context. It is cancelled when the
+// owning Supervisor is shut down.
+func (p *Process) Context() context.Context {
+	return p.ctx
+}
+
+// Logf logs a message tagged with the Worker's name.
+func (p *Process) Logf(format string, args ...interface{}) {
+	log.Printf("%s: %s", p.name, fmt.Sprintf(format, args...))
+}
+
+// Supervisor runs a set of Workers concurrently and collects any
+// errors they return.
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	workers []*Worker
+	wg      sync.WaitGroup
+	errs    []error
+}
+
+// WithContext creates a Supervisor whose Workers are cancelled when
+// ctx is done or when Shutdown is called, whichever comes first.
+func WithContext(ctx context.Context) *Supervisor {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Supervisor{ctx: ctx, cancel: cancel}
+}
+
+// Supervise registers a Worker to be started the next time Run is
+// called.
+func (s *Supervisor) Supervise(w *Worker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers = append(s.workers, w)
+}
+
+// Run starts every supervised Worker and blocks until all of them
+// have returned, collecting any errors they produced.
+func (s *Supervisor) Run() []error {
+	s.mu.Lock()
+	workers := append([]*Worker(nil), s.workers...)
+	s.mu.Unlock()
+
+	for _, w := range workers {
+		s.wg.Add(1)
+		go func(w *Worker) {
+			defer s.wg.Done()
+			p := &Process{ctx: s.ctx, name: w.Name}
+			if err := w.Work(p); err != nil {
+				s.mu.Lock()
+				s.errs = append(s.errs, fmt.Errorf("%s: %w", w.Name, err))
+				s.mu.Unlock()
+			}
+		}(w)
+	}
+	s.wg.Wait()
+
+	return s.errs
+}
+
+// Shutdown cancels every supervised Worker's context.
+func (s *Supervisor) Shutdown() {
+	s.cancel()
+}
@@ -0,0 +1,28 @@
+// Package watt holds the types watt uses to describe the state it
+// has assembled from its various inputs (Kubernetes, Consul, ...).
+package watt
+
+import (
+	"github.com/datawire/teleproxy/pkg/consulwatch"
+	"github.com/datawire/teleproxy/pkg/k8s"
+	"github.com/datawire/teleproxy/pkg/resolver"
+)
+
+// Snapshot is the full state watt has assembled at a point in time.
+// It is what gets serialized onto the aggregator's snapshots channel
+// for downstream consumers (e.g. the diagnostics UI, the Envoy
+// configurator) to act on.
+type Snapshot struct {
+	Kubernetes map[string][]k8s.Resource `json:"Kubernetes"`
+	Consul     ConsulSnapshot            `json:"Consul"`
+	// Resolvers holds the endpoints reported by every non-Consul
+	// Resolver backend, keyed first by resolver.Kind and then by
+	// service name. Consul keeps its own dedicated field above for
+	// backwards compatibility.
+	Resolvers map[string]map[string]resolver.Endpoints `json:"Resolvers,omitempty"`
+}
+
+// ConsulSnapshot is the Consul-derived portion of a Snapshot.
+type ConsulSnapshot struct {
+	Endpoints map[string]consulwatch.Endpoints `json:"Endpoints"`
+}